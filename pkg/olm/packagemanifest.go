@@ -3,14 +3,24 @@ package olm
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/openshift-kni/eco-goinfra/pkg/clients"
+	operatorsV1 "github.com/operator-framework/api/pkg/operators/v1"
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
 	pkgManifestV1 "github.com/operator-framework/operator-lifecycle-manager/pkg/package-server/apis/operators/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// clusterScopeNamespace is the conventional namespace used by OperatorGroups that install operators for
+// all namespaces on the cluster (e.g. "openshift-operators"). A Subscription created in this namespace
+// requires the operator to support the AllNamespaces install mode.
+const clusterScopeNamespace = "openshift-operators"
+
 // PackageManifestBuilder provides a struct for PackageManifest object from the cluster
 // and a PackageManifest definition.
 type PackageManifestBuilder struct {
@@ -64,6 +74,109 @@ func ListPackageManifest(
 	return pkgManifestObjects, nil
 }
 
+// PackageManifestListOptions narrows down a PackageManifest listing using fields that are either
+// label-selectable on the cluster or only available on PackageManifest's status.
+type PackageManifestListOptions struct {
+	// Catalog restricts the listing to PackageManifests served by the given CatalogSource.
+	Catalog string
+	// Publisher restricts the listing to PackageManifests with the given publisher.
+	Publisher string
+	// Provider restricts the listing to PackageManifests with the given provider.
+	Provider string
+	// Channel restricts the listing to PackageManifests that expose a channel with this name.
+	Channel string
+	// SupportedInstallMode restricts the listing to PackageManifests where any channel's current CSV
+	// supports this install mode, or just the default channel's if DefaultChannelOnly is also set.
+	SupportedInstallMode v1alpha1.InstallModeType
+	// DefaultChannelOnly, when true, only evaluates Channel and SupportedInstallMode against each
+	// PackageManifest's default channel instead of all of its channels.
+	DefaultChannelOnly bool
+}
+
+// ListPackageManifestWithOptions returns PackageManifest inventory in the given namespace, filtered by
+// options. Catalog and provider are translated into a label selector; publisher, channel, and install
+// mode are status-only fields and are therefore filtered client-side after listing.
+func ListPackageManifestWithOptions(
+	apiClient *clients.Settings, nsname string, options PackageManifestListOptions) ([]*PackageManifestBuilder, error) {
+	glog.V(100).Infof("Listing PackageManifests in the namespace %s with the options %v", nsname, options)
+
+	var labels []string
+
+	if options.Catalog != "" {
+		labels = append(labels, fmt.Sprintf("catalog=%s", options.Catalog))
+		labels = append(labels, fmt.Sprintf("catalog-namespace=%s", nsname))
+	}
+
+	if options.Provider != "" {
+		labels = append(labels, fmt.Sprintf("provider=%s", options.Provider))
+	}
+
+	pkgManifests, err := ListPackageManifest(apiClient, nsname, metaV1.ListOptions{
+		LabelSelector: strings.Join(labels, ","),
+	})
+
+	if err != nil {
+		glog.V(100).Infof("Failed to list PackageManifests in the namespace %s due to %s",
+			nsname, err.Error())
+
+		return nil, err
+	}
+
+	var filteredPkgManifests []*PackageManifestBuilder
+
+	for _, pkgManifestBuilder := range pkgManifests {
+		if options.Publisher != "" && pkgManifestBuilder.Object.Status.CatalogSourcePublisher != options.Publisher {
+			continue
+		}
+
+		if options.Channel != "" || options.SupportedInstallMode != "" {
+			if !pkgManifestBuilder.matchesChannelFilter(options) {
+				continue
+			}
+		}
+
+		filteredPkgManifests = append(filteredPkgManifests, pkgManifestBuilder)
+	}
+
+	return filteredPkgManifests, nil
+}
+
+// matchesChannelFilter reports whether the PackageManifest has a channel, possibly restricted to just its
+// default channel, matching the requested channel name and/or supported install mode.
+func (builder *PackageManifestBuilder) matchesChannelFilter(options PackageManifestListOptions) bool {
+	channels := builder.Object.Status.Channels
+
+	if options.DefaultChannelOnly {
+		channels = nil
+
+		for _, channel := range builder.Object.Status.Channels {
+			if channel.Name == builder.Object.Status.DefaultChannel {
+				channels = append(channels, channel)
+
+				break
+			}
+		}
+	}
+
+	for _, channel := range channels {
+		if options.Channel != "" && channel.Name != options.Channel {
+			continue
+		}
+
+		if options.SupportedInstallMode == "" {
+			return true
+		}
+
+		for _, installMode := range channel.CurrentCSVDesc.InstallModes {
+			if installMode.Type == options.SupportedInstallMode && installMode.Supported {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // PullPackageManifest loads an existing PackageManifest into Builder struct.
 func PullPackageManifest(apiClient *clients.Settings, name, nsname string) (*PackageManifestBuilder, error) {
 	glog.V(100).Infof("Pulling existing PackageManifest name %s in namespace %s", name, nsname)
@@ -132,6 +245,347 @@ func PullPackageManifestByCatalog(apiClient *clients.Settings, name, nsname,
 	return packageManifests[0], nil
 }
 
+// WaitUntilExists polls up to timeout for the PackageManifest to be created by the package-server.
+func (builder *PackageManifestBuilder) WaitUntilExists(ctx context.Context, timeout time.Duration) error {
+	glog.V(100).Infof("Waiting up to %s for PackageManifest %s in namespace %s to exist",
+		timeout, builder.Definition.Name, builder.Definition.Namespace)
+
+	return wait.PollUntilContextTimeout(
+		ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+			pkgManifest, err := builder.apiClient.PackageManifestInterface.PackageManifests(
+				builder.Definition.Namespace).Get(ctx, builder.Definition.Name, metaV1.GetOptions{})
+
+			if err != nil {
+				if k8serrors.IsNotFound(err) {
+					return false, nil
+				}
+
+				return false, err
+			}
+
+			builder.Object = pkgManifest
+
+			return true, nil
+		})
+}
+
+// WaitUntilChannelExists polls up to timeout, combined, for the PackageManifest to exist and for the
+// given channel to appear on it.
+func (builder *PackageManifestBuilder) WaitUntilChannelExists(
+	ctx context.Context, channel string, timeout time.Duration) error {
+	glog.V(100).Infof("Waiting up to %s for channel %s to exist on PackageManifest %s in namespace %s",
+		timeout, channel, builder.Definition.Name, builder.Definition.Namespace)
+
+	if channel == "" {
+		return fmt.Errorf("packagemanifest 'channel' parameter can not be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := builder.WaitUntilExists(ctx, timeout); err != nil {
+		return err
+	}
+
+	return wait.PollUntilContextTimeout(
+		ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+			pkgManifest, err := builder.apiClient.PackageManifestInterface.PackageManifests(
+				builder.Definition.Namespace).Get(ctx, builder.Definition.Name, metaV1.GetOptions{})
+
+			if err != nil {
+				return false, err
+			}
+
+			builder.Object = pkgManifest
+
+			for _, pkgChannel := range pkgManifest.Status.Channels {
+				if pkgChannel.Name == channel {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		})
+}
+
+// PackageManifestProgress carries a single update emitted while waiting for a PackageManifest or one of
+// its channels to become available.
+type PackageManifestProgress struct {
+	// Message is a human-readable description of the current wait state.
+	Message string
+	// Err is set when the wait terminated due to an error; Done is also true in that case.
+	Err error
+	// Done indicates the wait has finished, either successfully or with Err set.
+	Done bool
+}
+
+// WaitUntilExistsWithProgress starts polling up to timeout for the PackageManifest to be created by the
+// package-server and returns a channel of progress updates. The channel is closed once the wait succeeds
+// or fails terminally; callers that don't care about progress can simply drain it and check the final
+// PackageManifestProgress.Err.
+func (builder *PackageManifestBuilder) WaitUntilExistsWithProgress(
+	ctx context.Context, timeout time.Duration) (<-chan PackageManifestProgress, error) {
+	glog.V(100).Infof("Waiting up to %s for PackageManifest %s in namespace %s to exist, with progress",
+		timeout, builder.Definition.Name, builder.Definition.Namespace)
+
+	progressCh := make(chan PackageManifestProgress)
+
+	go func() {
+		defer close(progressCh)
+
+		progressCh <- PackageManifestProgress{
+			Message: fmt.Sprintf("waiting for catalog to publish package %s", builder.Definition.Name),
+		}
+
+		err := builder.WaitUntilExists(ctx, timeout)
+		if err != nil {
+			progressCh <- PackageManifestProgress{Err: err, Done: true}
+
+			return
+		}
+
+		progressCh <- PackageManifestProgress{
+			Message: fmt.Sprintf("package %s is now available", builder.Definition.Name),
+			Done:    true,
+		}
+	}()
+
+	return progressCh, nil
+}
+
+// WaitUntilChannelExistsWithProgress starts polling up to timeout for the given channel to appear on the
+// PackageManifest and returns a channel of progress updates, in the same fashion as
+// WaitUntilExistsWithProgress.
+func (builder *PackageManifestBuilder) WaitUntilChannelExistsWithProgress(
+	ctx context.Context, channel string, timeout time.Duration) (<-chan PackageManifestProgress, error) {
+	glog.V(100).Infof(
+		"Waiting up to %s for channel %s to exist on PackageManifest %s in namespace %s, with progress",
+		timeout, channel, builder.Definition.Name, builder.Definition.Namespace)
+
+	if channel == "" {
+		return nil, fmt.Errorf("packagemanifest 'channel' parameter can not be empty")
+	}
+
+	progressCh := make(chan PackageManifestProgress)
+
+	go func() {
+		defer close(progressCh)
+
+		progressCh <- PackageManifestProgress{
+			Message: fmt.Sprintf("waiting for catalog to publish package %s", builder.Definition.Name),
+		}
+
+		progressCh <- PackageManifestProgress{
+			Message: fmt.Sprintf("channel %s not yet available", channel),
+		}
+
+		if err := builder.WaitUntilChannelExists(ctx, channel, timeout); err != nil {
+			progressCh <- PackageManifestProgress{Err: err, Done: true}
+
+			return
+		}
+
+		progressCh <- PackageManifestProgress{
+			Message: fmt.Sprintf("channel %s is now available", channel),
+			Done:    true,
+		}
+	}()
+
+	return progressCh, nil
+}
+
+// DefaultLogProgress is a convenience consumer for a PackageManifestProgress channel that glogs every
+// message it receives, so simple callers don't have to build their own consumer loop.
+func DefaultLogProgress(progressCh <-chan PackageManifestProgress) {
+	for progress := range progressCh {
+		if progress.Err != nil {
+			glog.V(100).Infof("packagemanifest wait failed: %s", progress.Err.Error())
+
+			continue
+		}
+
+		if progress.Message != "" {
+			glog.V(100).Infof("packagemanifest wait: %s", progress.Message)
+		}
+	}
+}
+
+// WaitForPackageManifestInCatalog polls up to timeout for a PackageManifest with the given name to be
+// published in the given catalog, returning it as soon as it is found.
+func WaitForPackageManifestInCatalog(
+	apiClient *clients.Settings, name, nsname, catalog string, timeout time.Duration) (*PackageManifestBuilder, error) {
+	glog.V(100).Infof("Waiting up to %s for PackageManifest %s in namespace %s to appear in catalog %s",
+		timeout, name, nsname, catalog)
+
+	var (
+		pkgManifestBuilder *PackageManifestBuilder
+		lastErr            error
+	)
+
+	err := wait.PollUntilContextTimeout(
+		context.Background(), time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+			builder, err := PullPackageManifestByCatalog(apiClient, name, nsname, catalog)
+			if err == nil {
+				pkgManifestBuilder = builder
+
+				return true, nil
+			}
+
+			lastErr = err
+
+			if k8serrors.IsNotFound(err) || strings.Contains(err.Error(), "no matching PackageManifests") {
+				return false, nil
+			}
+
+			return false, err
+		})
+
+	if err != nil {
+		if wait.Interrupted(err) {
+			return nil, lastErr
+		}
+
+		return nil, err
+	}
+
+	return pkgManifestBuilder, nil
+}
+
+// CreateSubscription builds and creates a Subscription for the pulled PackageManifest in nsname, using
+// channel if non-empty or the PackageManifest's default channel otherwise. installPlanApproval is applied
+// verbatim as the Subscription's install plan approval (e.g. "Automatic" or "Manual"). It validates that
+// the requested channel exists and that its CSV supports being installed into nsname before creating
+// anything on the cluster.
+func (builder *PackageManifestBuilder) CreateSubscription(
+	nsname, channel, installPlanApproval string) (*SubscriptionBuilder, error) {
+	glog.V(100).Infof(
+		"Creating Subscription for PackageManifest %s in namespace %s with channel %s and approval %s",
+		builder.Definition.Name, nsname, channel, installPlanApproval)
+
+	if builder.Object == nil {
+		return nil, fmt.Errorf("packagemanifest object %s does not exist in namespace %s",
+			builder.Definition.Name, builder.Definition.Namespace)
+	}
+
+	if nsname == "" {
+		return nil, fmt.Errorf("packagemanifest 'nsname' parameter can not be empty")
+	}
+
+	if channel == "" {
+		defaultChannel, err := builder.GetDefaultChannel()
+		if err != nil {
+			return nil, err
+		}
+
+		channel = defaultChannel
+	}
+
+	if _, err := builder.GetChannel(channel); err != nil {
+		return nil, err
+	}
+
+	if err := builder.validateInstallModeForNamespace(channel, nsname); err != nil {
+		return nil, err
+	}
+
+	subscriptionBuilder := &SubscriptionBuilder{
+		apiClient: builder.apiClient,
+		Definition: &v1alpha1.Subscription{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      builder.Object.Name,
+				Namespace: nsname,
+			},
+			Spec: &v1alpha1.SubscriptionSpec{
+				Channel:                channel,
+				Package:                builder.Object.Status.PackageName,
+				CatalogSource:          builder.Object.Status.CatalogSource,
+				CatalogSourceNamespace: builder.Object.Status.CatalogSourceNamespace,
+				InstallPlanApproval:    v1alpha1.Approval(installPlanApproval),
+			},
+		},
+	}
+
+	return subscriptionBuilder.Create()
+}
+
+// EnsureOperatorGroup creates an OperatorGroup in nsname for the pulled PackageManifest's package if one
+// does not already exist, restricting it to nsname so the operator is only watching its own namespace.
+func (builder *PackageManifestBuilder) EnsureOperatorGroup(nsname string) error {
+	glog.V(100).Infof("Ensuring OperatorGroup exists in namespace %s for PackageManifest %s",
+		nsname, builder.Definition.Name)
+
+	if builder.Object == nil {
+		return fmt.Errorf("packagemanifest object %s does not exist in namespace %s",
+			builder.Definition.Name, builder.Definition.Namespace)
+	}
+
+	if nsname == "" {
+		return fmt.Errorf("packagemanifest 'nsname' parameter can not be empty")
+	}
+
+	operatorGroups, err := builder.apiClient.OperatorGroupInterface.OperatorGroups(nsname).List(
+		context.Background(), metaV1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if len(operatorGroups.Items) > 0 {
+		return nil
+	}
+
+	newOperatorGroup := &operatorsV1.OperatorGroup{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-operator-group", builder.Object.Status.PackageName),
+			Namespace: nsname,
+		},
+		Spec: operatorsV1.OperatorGroupSpec{
+			TargetNamespaces: []string{nsname},
+		},
+	}
+
+	_, err = builder.apiClient.OperatorGroupInterface.OperatorGroups(nsname).Create(
+		context.Background(), newOperatorGroup, metaV1.CreateOptions{})
+
+	return err
+}
+
+// validateInstallModeForNamespace refuses to subscribe a PackageManifest into nsname when the channel's
+// CSV does not declare support for the install mode implied by nsname (AllNamespaces for the well-known
+// cluster-scope namespace; any of AllNamespaces, OwnNamespace or SingleNamespace otherwise).
+func (builder *PackageManifestBuilder) validateInstallModeForNamespace(channel, nsname string) error {
+	installModes, err := builder.GetInstallModes(channel)
+	if err != nil {
+		return err
+	}
+
+	if nsname == clusterScopeNamespace {
+		for _, installMode := range installModes {
+			if installMode.Type == v1alpha1.InstallModeTypeAllNamespaces && installMode.Supported {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("packagemanifest %s channel %s does not support being installed into namespace %s",
+			builder.Object.Name, channel, nsname)
+	}
+
+	for _, installMode := range installModes {
+		if !installMode.Supported {
+			continue
+		}
+
+		switch installMode.Type {
+		case v1alpha1.InstallModeTypeAllNamespaces,
+			v1alpha1.InstallModeTypeOwnNamespace,
+			v1alpha1.InstallModeTypeSingleNamespace:
+			return nil
+		}
+	}
+
+	return fmt.Errorf("packagemanifest %s channel %s does not support being installed into namespace %s",
+		builder.Object.Name, channel, nsname)
+}
+
 // Exists checks whether the given PackageManifest exists.
 func (builder *PackageManifestBuilder) Exists() bool {
 	glog.V(100).Infof(
@@ -144,6 +598,103 @@ func (builder *PackageManifestBuilder) Exists() bool {
 	return err == nil || !k8serrors.IsNotFound(err)
 }
 
+// GetDefaultChannel returns the name of the default channel for the pulled PackageManifest.
+func (builder *PackageManifestBuilder) GetDefaultChannel() (string, error) {
+	glog.V(100).Infof("Getting default channel for PackageManifest %s in namespace %s",
+		builder.Definition.Name, builder.Definition.Namespace)
+
+	if builder.Object == nil {
+		return "", fmt.Errorf("packagemanifest object %s does not exist in namespace %s",
+			builder.Definition.Name, builder.Definition.Namespace)
+	}
+
+	if builder.Object.Status.DefaultChannel == "" {
+		return "", fmt.Errorf("packagemanifest %s in namespace %s has no default channel",
+			builder.Object.Name, builder.Object.Namespace)
+	}
+
+	return builder.Object.Status.DefaultChannel, nil
+}
+
+// GetChannels returns all channels available for the pulled PackageManifest.
+func (builder *PackageManifestBuilder) GetChannels() ([]pkgManifestV1.PackageChannel, error) {
+	glog.V(100).Infof("Getting channels for PackageManifest %s in namespace %s",
+		builder.Definition.Name, builder.Definition.Namespace)
+
+	if builder.Object == nil {
+		return nil, fmt.Errorf("packagemanifest object %s does not exist in namespace %s",
+			builder.Definition.Name, builder.Definition.Namespace)
+	}
+
+	if len(builder.Object.Status.Channels) == 0 {
+		return nil, fmt.Errorf("packagemanifest %s in namespace %s has no channels",
+			builder.Object.Name, builder.Object.Namespace)
+	}
+
+	return builder.Object.Status.Channels, nil
+}
+
+// GetChannel returns the channel matching the given name for the pulled PackageManifest.
+func (builder *PackageManifestBuilder) GetChannel(name string) (*pkgManifestV1.PackageChannel, error) {
+	glog.V(100).Infof("Getting channel %s for PackageManifest %s in namespace %s",
+		name, builder.Definition.Name, builder.Definition.Namespace)
+
+	if name == "" {
+		return nil, fmt.Errorf("packagemanifest 'name' parameter can not be empty")
+	}
+
+	channels, err := builder.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range channels {
+		if channel.Name == name {
+			return &channel, nil
+		}
+	}
+
+	return nil, fmt.Errorf("packagemanifest %s in namespace %s has no channel named %s",
+		builder.Object.Name, builder.Object.Namespace, name)
+}
+
+// GetCurrentCSV returns the name of the CSV currently published in the given channel.
+func (builder *PackageManifestBuilder) GetCurrentCSV(channel string) (string, error) {
+	glog.V(100).Infof("Getting current CSV for PackageManifest %s in namespace %s from channel %s",
+		builder.Definition.Name, builder.Definition.Namespace, channel)
+
+	pkgChannel, err := builder.GetChannel(channel)
+	if err != nil {
+		return "", err
+	}
+
+	if pkgChannel.CurrentCSV == "" {
+		return "", fmt.Errorf("packagemanifest %s in namespace %s has no current CSV in channel %s",
+			builder.Object.Name, builder.Object.Namespace, channel)
+	}
+
+	return pkgChannel.CurrentCSV, nil
+}
+
+// GetInstallModes returns the install modes declared by the CSV currently published in the given channel,
+// including those whose Supported flag is false.
+func (builder *PackageManifestBuilder) GetInstallModes(channel string) ([]v1alpha1.InstallMode, error) {
+	glog.V(100).Infof("Getting install modes for PackageManifest %s in namespace %s from channel %s",
+		builder.Definition.Name, builder.Definition.Namespace, channel)
+
+	pkgChannel, err := builder.GetChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pkgChannel.CurrentCSVDesc.InstallModes) == 0 {
+		return nil, fmt.Errorf("packagemanifest %s in namespace %s has no install modes in channel %s",
+			builder.Object.Name, builder.Object.Namespace, channel)
+	}
+
+	return pkgChannel.CurrentCSVDesc.InstallModes, nil
+}
+
 // Delete removes a PackageManifest.
 func (builder *PackageManifestBuilder) Delete() error {
 	glog.V(100).Infof("Deleting PackageManifest %s in namespace %s", builder.Definition.Name,
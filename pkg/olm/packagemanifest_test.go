@@ -0,0 +1,172 @@
+package olm
+
+import (
+	"testing"
+
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+	pkgManifestV1 "github.com/operator-framework/operator-lifecycle-manager/pkg/package-server/apis/operators/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func buildTestPackageManifestBuilder(
+	defaultChannel string, channels []pkgManifestV1.PackageChannel) *PackageManifestBuilder {
+	testPkgManifest := &pkgManifestV1.PackageManifest{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "test-package",
+			Namespace: "test-namespace",
+		},
+		Status: pkgManifestV1.PackageManifestStatus{
+			DefaultChannel: defaultChannel,
+			Channels:       channels,
+		},
+	}
+
+	return &PackageManifestBuilder{
+		Definition: testPkgManifest,
+		Object:     testPkgManifest,
+	}
+}
+
+func TestMatchesChannelFilter(t *testing.T) {
+	stableChannel := pkgManifestV1.PackageChannel{
+		Name: "stable",
+		CurrentCSVDesc: pkgManifestV1.CSVDescription{
+			InstallModes: []v1alpha1.InstallMode{
+				{Type: v1alpha1.InstallModeTypeOwnNamespace, Supported: true},
+			},
+		},
+	}
+	alphaChannel := pkgManifestV1.PackageChannel{
+		Name: "alpha",
+		CurrentCSVDesc: pkgManifestV1.CSVDescription{
+			InstallModes: []v1alpha1.InstallMode{
+				{Type: v1alpha1.InstallModeTypeAllNamespaces, Supported: true},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		options  PackageManifestListOptions
+		expected bool
+	}{
+		{
+			name:     "matches by channel name",
+			options:  PackageManifestListOptions{Channel: "stable"},
+			expected: true,
+		},
+		{
+			name:     "no channel with requested name",
+			options:  PackageManifestListOptions{Channel: "missing"},
+			expected: false,
+		},
+		{
+			name:     "matches by supported install mode",
+			options:  PackageManifestListOptions{SupportedInstallMode: v1alpha1.InstallModeTypeAllNamespaces},
+			expected: true,
+		},
+		{
+			name:     "no channel supports the requested install mode",
+			options:  PackageManifestListOptions{SupportedInstallMode: v1alpha1.InstallModeTypeSingleNamespace},
+			expected: false,
+		},
+		{
+			name: "channel and install mode must match the same channel",
+			options: PackageManifestListOptions{
+				Channel:              "stable",
+				SupportedInstallMode: v1alpha1.InstallModeTypeAllNamespaces,
+			},
+			expected: false,
+		},
+		{
+			name: "default channel only excludes non-default channels",
+			options: PackageManifestListOptions{
+				Channel:            "alpha",
+				DefaultChannelOnly: true,
+			},
+			expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			builder := buildTestPackageManifestBuilder("stable", []pkgManifestV1.PackageChannel{stableChannel, alphaChannel})
+
+			result := builder.matchesChannelFilter(testCase.options)
+
+			if result != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, result)
+			}
+		})
+	}
+}
+
+func buildTestInstallModeChannel(channelName string, installModes ...v1alpha1.InstallMode) pkgManifestV1.PackageChannel {
+	return pkgManifestV1.PackageChannel{
+		Name: channelName,
+		CurrentCSVDesc: pkgManifestV1.CSVDescription{
+			InstallModes: installModes,
+		},
+	}
+}
+
+func TestValidateInstallModeForNamespace(t *testing.T) {
+	testCases := []struct {
+		name        string
+		channel     pkgManifestV1.PackageChannel
+		nsname      string
+		expectedErr bool
+	}{
+		{
+			name: "own namespace supported, own-namespace subscription",
+			channel: buildTestInstallModeChannel("stable",
+				v1alpha1.InstallMode{Type: v1alpha1.InstallModeTypeOwnNamespace, Supported: true}),
+			nsname:      "test-operator",
+			expectedErr: false,
+		},
+		{
+			name: "single namespace supported, own-namespace subscription",
+			channel: buildTestInstallModeChannel("stable",
+				v1alpha1.InstallMode{Type: v1alpha1.InstallModeTypeSingleNamespace, Supported: true}),
+			nsname:      "test-operator",
+			expectedErr: false,
+		},
+		{
+			name: "all namespaces supported, cluster-scope subscription",
+			channel: buildTestInstallModeChannel("stable",
+				v1alpha1.InstallMode{Type: v1alpha1.InstallModeTypeAllNamespaces, Supported: true}),
+			nsname:      clusterScopeNamespace,
+			expectedErr: false,
+		},
+		{
+			name: "only own-namespace supported, cluster-scope subscription is refused",
+			channel: buildTestInstallModeChannel("stable",
+				v1alpha1.InstallMode{Type: v1alpha1.InstallModeTypeOwnNamespace, Supported: true}),
+			nsname:      clusterScopeNamespace,
+			expectedErr: true,
+		},
+		{
+			name: "install mode declared but not supported",
+			channel: buildTestInstallModeChannel("stable",
+				v1alpha1.InstallMode{Type: v1alpha1.InstallModeTypeOwnNamespace, Supported: false}),
+			nsname:      "test-operator",
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			builder := buildTestPackageManifestBuilder("stable", []pkgManifestV1.PackageChannel{testCase.channel})
+
+			err := builder.validateInstallModeForNamespace(testCase.channel.Name, testCase.nsname)
+
+			if testCase.expectedErr && err == nil {
+				t.Errorf("expected an error, got nil")
+			}
+
+			if !testCase.expectedErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}